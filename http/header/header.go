@@ -0,0 +1,71 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package header defines the names and values of the HTTP headers used
+// across the Knative networking layer.
+package header
+
+const (
+	// UserAgentKey is the constant for header "User-Agent".
+	UserAgentKey = "User-Agent"
+
+	// ProbeHeaderName is the name of a header that can be added to
+	// requests to probe the knative networking layer.  Requests
+	// with this header will not be passed to the user container or
+	// included in request metrics.
+	ProbeHeaderName = "K-Network-Probe"
+
+	// ProbeHeaderValue is the value of a header that can be added to
+	// requests to probe the knative networking layer.  Requests
+	// with `K-Network-Probe` this value will not be passed to the user
+	// container or included in request metrics.
+	ProbeHeaderValue = "probe"
+
+	// HashHeaderName is the name of an internal header that Ingress controller
+	// uses to find out which version of the networking config is deployed.
+	HashHeaderName = "K-Network-Hash"
+
+	// Since K8s 1.8, prober requests have
+	//   User-Agent = "kube-probe/{major-version}.{minor-version}".
+	KubeProbeUAPrefix = "kube-probe/"
+
+	// KubeletProbeHeaderName used to carry kubelet probes through Istio's
+	// mTLS rewriting, back when Istio didn't propagate the original
+	// kube-probe User-Agent. Istio now preserves that User-Agent across
+	// the mTLS rewrite, so probes are detected via UserAgentKey instead.
+	//
+	// Deprecated: this header is no longer set or checked; use
+	// UserAgentKey and KubeProbeUAPrefix.
+	KubeletProbeHeaderName = "K-Kubelet-Probe"
+
+	// OriginalHostKey is the header key used to store the original
+	// host of a request before it is rewritten by the network layer,
+	// e.g. by the activator or ingress before proxying to the
+	// queue-proxy.
+	OriginalHostKey = "K-Original-Host"
+
+	// RouteTagKey is the header key used to propagate the tag of the
+	// Knative Route revision that a request has been targeted at, so
+	// that downstream hops can make tag-aware routing decisions.
+	RouteTagKey = "K-Route-Tag"
+)
+
+// KubeProbeUserAgent returns the User-Agent value kubelet sends when
+// probing, for the given "{major}.{minor}" Kubernetes version, e.g.
+// KubeProbeUserAgent("1.14") == "kube-probe/1.14".
+func KubeProbeUserAgent(majorMinor string) string {
+	return KubeProbeUAPrefix + majorMinor
+}
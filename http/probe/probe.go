@@ -0,0 +1,110 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package probe provides helpers for recognizing and serving the probe
+// requests used by the Knative networking layer.
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"knative.dev/pkg/http/header"
+)
+
+// IsKubeletProbe returns true if the request is a Kubernetes probe.
+//
+// This used to also check header.KubeletProbeHeaderName, a header Istio
+// added to mTLS-rewritten probes because it didn't propagate the
+// original kube-probe User-Agent. Istio now propagates that User-Agent
+// unchanged, so detection is User-Agent only; see
+// header.KubeletProbeHeaderName.
+func IsKubeletProbe(r *http.Request) bool {
+	return IsKubeletProbeUA(r.Header.Get(header.UserAgentKey))
+}
+
+// IsKubeletProbeUA returns true if ua is the User-Agent value kubelet
+// sends when probing, e.g. "kube-probe/1.14". It's useful for
+// middleware that already has the User-Agent string in hand (from
+// http.Request.UserAgent(), a log line, etc.) and wants to avoid a
+// second header lookup.
+func IsKubeletProbeUA(ua string) bool {
+	return strings.HasPrefix(ua, header.KubeProbeUAPrefix)
+}
+
+// IsKProbe returns true if the request is a knatvie probe.
+func IsKProbe(r *http.Request) bool {
+	return r.Header.Get(header.ProbeHeaderName) == header.ProbeHeaderValue
+}
+
+// ServeKProbe serve KProbe requests.
+func ServeKProbe(w http.ResponseWriter, r *http.Request) {
+	hh := r.Header.Get(header.HashHeaderName)
+	if hh == "" {
+		http.Error(w, fmt.Sprintf("a probe request must contain a non-empty %q header", header.HashHeaderName), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(header.HashHeaderName, hh)
+	w.WriteHeader(http.StatusOK)
+}
+
+// NewHandler returns an http.Handler that intercepts knative probe
+// requests and serves them directly via ServeKProbe, forwarding
+// everything else to next.
+func NewHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsKProbe(r) {
+			ServeKProbe(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ComponentHeaderName is the name of the response header that
+// ProbeHandler sets to identify which component on the data path
+// terminated the probe, e.g. "activator" or "queue-proxy".
+const ComponentHeaderName = "K-Network-Probe-Component"
+
+// ProbeHandler is an http.Handler that intercepts knative probe
+// requests before they reach NextHandler, echoing back the
+// K-Network-Hash header and identifying Component as the component
+// that answered the probe. This lets operators tell which hop in the
+// data path a given probe terminated at.
+type ProbeHandler struct {
+	NextHandler http.Handler
+	Component   string
+}
+
+// NewProbeHandler creates a new ProbeHandler.
+func NewProbeHandler(next http.Handler, component string) *ProbeHandler {
+	return &ProbeHandler{
+		NextHandler: next,
+		Component:   component,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !IsKProbe(r) {
+		h.NextHandler.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set(ComponentHeaderName, h.Component)
+	ServeKProbe(w, r)
+}
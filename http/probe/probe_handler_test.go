@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"knative.dev/pkg/http/header"
+)
+
+func TestProbeHandlerEchoesHashAndComponent(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("NextHandler should not be called for a probe request")
+	})
+	h := NewProbeHandler(next, "activator")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(header.ProbeHeaderName, header.ProbeHeaderValue)
+	req.Header.Set(header.HashHeaderName, "the-hash")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+	if got, want := w.Header().Get(header.HashHeaderName), "the-hash"; got != want {
+		t.Errorf("%s = %q, want %q", header.HashHeaderName, got, want)
+	}
+	if got, want := w.Header().Get(ComponentHeaderName), "activator"; got != want {
+		t.Errorf("%s = %q, want %q", ComponentHeaderName, got, want)
+	}
+}
+
+func TestProbeHandlerMissingHash(t *testing.T) {
+	h := NewProbeHandler(http.NotFoundHandler(), "queue-proxy")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(header.ProbeHeaderName, header.ProbeHeaderValue)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusBadRequest; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+}
+
+func TestProbeHandlerPassThrough(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := NewProbeHandler(next, "activator")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if !called {
+		t.Error("NextHandler was not called for a non-probe request")
+	}
+	if got, want := w.Code, http.StatusTeapot; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+	if got := w.Header().Get(ComponentHeaderName); got != "" {
+		t.Errorf("%s = %q, want empty", ComponentHeaderName, got)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxy provides helpers for building HTTP reverse proxies used
+// on the Knative data path.
+package proxy
+
+import "sync"
+
+// bufferSize is the size of the buffers handed out by BufferPool. It is
+// the same default io.Copy would use, but pooled to avoid repeated
+// allocations on the hot request path.
+const bufferSize = 32 * 1024
+
+// BufferPool is a sync.Pool-backed implementation of
+// httputil.BufferPool, suitable for use with httputil.ReverseProxy.
+type BufferPool struct {
+	pool *sync.Pool
+}
+
+// NewBufferPool returns a BufferPool ready for use with
+// httputil.ReverseProxy.
+func NewBufferPool() *BufferPool {
+	return &BufferPool{
+		pool: &sync.Pool{
+			New: func() interface{} {
+				return make([]byte, bufferSize)
+			},
+		},
+	}
+}
+
+// Get implements httputil.BufferPool.
+func (b *BufferPool) Get() []byte {
+	return b.pool.Get().([]byte)
+}
+
+// Put implements httputil.BufferPool.
+func (b *BufferPool) Put(bytes []byte) {
+	b.pool.Put(bytes)
+}
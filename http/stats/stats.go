@@ -0,0 +1,61 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stats tracks request concurrency and throughput so that it
+// can be reported upstream to the autoscaler.
+package stats
+
+import "sync/atomic"
+
+// ReqEvent is the type of a request lifecycle event handled by
+// RequestStats.
+type ReqEvent int
+
+const (
+	// ReqIn represents the arrival of a request.
+	ReqIn ReqEvent = iota
+	// ReqOut represents the completion of a request.
+	ReqOut
+)
+
+// RequestStats tracks in-flight request concurrency and the total
+// number of requests seen, for periodic reporting to the autoscaler.
+type RequestStats struct {
+	requestCount int64
+	concurrency  int64
+}
+
+// NewRequestStats returns an empty RequestStats.
+func NewRequestStats() *RequestStats {
+	return &RequestStats{}
+}
+
+// HandleEvent updates the tracked counters in response to e.
+func (s *RequestStats) HandleEvent(e ReqEvent) {
+	switch e {
+	case ReqIn:
+		atomic.AddInt64(&s.requestCount, 1)
+		atomic.AddInt64(&s.concurrency, 1)
+	case ReqOut:
+		atomic.AddInt64(&s.concurrency, -1)
+	}
+}
+
+// Report returns the total request count and current concurrency
+// observed since the RequestStats was created.
+func (s *RequestStats) Report() (requestCount, concurrency int64) {
+	return atomic.LoadInt64(&s.requestCount), atomic.LoadInt64(&s.concurrency)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"knative.dev/pkg/http/probe"
+)
+
+// Drainer wraps an http.Handler to manage the data path's graceful
+// shutdown lifecycle. Once Drain is called, the Drainer starts failing
+// KProbe readiness checks -- so the network layer stops routing new
+// traffic here -- while still serving in-flight and newly arriving
+// requests for QuietPeriod, resetting that quiet period every time a
+// non-probe request arrives. This way the channel returned by Drain
+// only closes once the network layer has actually stopped sending
+// traffic to this pod, rather than after an arbitrary fixed delay.
+type Drainer struct {
+	// NextHandler is the handler wrapped by the Drainer.
+	NextHandler http.Handler
+
+	// QuietPeriod is how long the Drainer waits, after the most recent
+	// non-probe request, before closing the channel returned by Drain.
+	// Defaults to DefaultDrainTimeout if zero.
+	QuietPeriod time.Duration
+
+	mu         sync.RWMutex
+	draining   bool
+	closed     bool
+	generation uint64
+	timer      *time.Timer
+	drainCh    chan struct{}
+}
+
+func (d *Drainer) quietPeriod() time.Duration {
+	if d.QuietPeriod > 0 {
+		return d.QuietPeriod
+	}
+	return DefaultDrainTimeout
+}
+
+// ServeHTTP implements http.Handler. It answers KProbe requests itself
+// -- succeeding them while healthy, failing them with 503 once
+// draining -- so a Drainer alone is a complete probe-serving middleware
+// and callers don't also need probe.NewHandler in front of it. Every
+// other request resets the quiet period while draining, then forwards
+// to NextHandler.
+func (d *Drainer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.RLock()
+	draining := d.draining
+	d.mu.RUnlock()
+
+	if probe.IsKProbe(r) {
+		if draining {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		probe.ServeKProbe(w, r)
+		return
+	}
+
+	if draining {
+		d.Reset()
+	}
+
+	d.NextHandler.ServeHTTP(w, r)
+}
+
+// Drain puts the Drainer into drain mode: readiness probes start
+// failing immediately, while other traffic is still served. It returns
+// a channel that closes once QuietPeriod has elapsed without a new
+// non-probe request arriving. Calling Drain again before the channel
+// closes is a no-op that returns the same channel.
+func (d *Drainer) Drain() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return d.drainCh
+	}
+
+	d.draining = true
+	d.closed = false
+	d.drainCh = make(chan struct{})
+	d.arm()
+	return d.drainCh
+}
+
+// arm schedules a new quiet-period timer and bumps generation so that
+// fire, the timer's callback, can recognize a firing from a since-reset
+// timer as stale. Must be called with d.mu held.
+func (d *Drainer) arm() {
+	d.generation++
+	gen := d.generation
+	d.timer = time.AfterFunc(d.quietPeriod(), func() { d.fire(gen) })
+}
+
+// fire is arm's timer callback. It closes drainCh, but only if gen is
+// still the current generation: Reset can win a race against an
+// in-flight timer firing by re-arming (which bumps generation) before
+// the stale firing acquires d.mu, and that stale firing must then be a
+// no-op rather than closing drainCh out from under the reset quiet
+// period. closed guards the uncontended case of the timer firing twice
+// (it can't, but belt-and-suspenders costs nothing) and documents why
+// close is only ever reached once.
+func (d *Drainer) fire(gen uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed || gen != d.generation {
+		return
+	}
+	d.closed = true
+	close(d.drainCh)
+}
+
+// Reset restarts the quiet period, as though a new request had just
+// arrived. It is a no-op when the Drainer is not currently draining, or
+// once the quiet period has already elapsed and drainCh has closed.
+func (d *Drainer) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.draining || d.closed {
+		return
+	}
+	d.timer.Stop()
+	d.arm()
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"knative.dev/pkg/http/header"
+)
+
+func TestDrainerServesProbesItselfWhileHealthy(t *testing.T) {
+	d := &Drainer{
+		NextHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("NextHandler should not be called for a probe request")
+		}),
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(header.ProbeHeaderName, header.ProbeHeaderValue)
+	req.Header.Set(header.HashHeaderName, "the-hash")
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, req)
+
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+	if got, want := w.Header().Get(header.HashHeaderName), "the-hash"; got != want {
+		t.Errorf("%s = %q, want %q", header.HashHeaderName, got, want)
+	}
+}
+
+func TestDrainerServesAndFailsProbesWhileDraining(t *testing.T) {
+	d := &Drainer{
+		NextHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		QuietPeriod: time.Hour,
+	}
+
+	d.Drain()
+
+	probeReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	probeReq.Header.Set(header.ProbeHeaderName, header.ProbeHeaderValue)
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, probeReq)
+	if got, want := w.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("probe Code = %d, want %d", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("non-probe Code = %d, want %d", got, want)
+	}
+}
+
+// TestDrainerProbeFlapAfterQuietPeriod reproduces the scenario where the
+// quiet period elapses and drainCh closes, and then another request
+// arrives and calls Reset. Reset must not rearm the already-fired timer
+// and must not cause fire to close drainCh a second time.
+func TestDrainerProbeFlapAfterQuietPeriod(t *testing.T) {
+	d := &Drainer{
+		NextHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		QuietPeriod: time.Millisecond,
+	}
+
+	ch := d.Drain()
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("drain channel did not close within QuietPeriod")
+	}
+
+	// A request arriving after drainCh has closed must not panic, even
+	// though the Drainer still reports draining == true.
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("Code = %d, want %d", got, want)
+	}
+
+	// Give any (incorrectly) rearmed timer a chance to fire and panic
+	// before the test process exits.
+	time.Sleep(10 * time.Millisecond)
+}
+
+// TestDrainerStaleTimerFiringAfterResetIsNoOp drives the exact race the
+// closed bool alone couldn't prevent: a quiet-period timer fires (so its
+// callback is in flight) at the same moment Reset re-arms the timer for
+// another quiet period. The stale callback must lose -- it must not
+// close drainCh out from under the reset -- even though closed is still
+// false when it runs.
+func TestDrainerStaleTimerFiringAfterResetIsNoOp(t *testing.T) {
+	d := &Drainer{
+		NextHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		QuietPeriod: time.Hour,
+	}
+
+	ch := d.Drain()
+	staleGen := d.generation
+
+	// A request arrives and wins the race: it resets the quiet period
+	// before the stale firing (simulated below) gets the lock.
+	d.Reset()
+
+	// The already-in-flight callback for the pre-reset generation now
+	// acquires the lock and runs.
+	d.fire(staleGen)
+
+	select {
+	case <-ch:
+		t.Fatal("drainCh closed from a stale timer firing that Reset had already superseded")
+	default:
+	}
+
+	// The real, current-generation firing still closes drainCh.
+	d.fire(d.generation)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("drainCh did not close on the current generation's firing")
+	}
+}
+
+func TestDrainerConcurrentRequestsResetQuietPeriod(t *testing.T) {
+	d := &Drainer{
+		NextHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		QuietPeriod: 50 * time.Millisecond,
+	}
+	ch := d.Drain()
+
+	stop := time.After(120 * time.Millisecond)
+	var wg sync.WaitGroup
+loop:
+	for {
+		select {
+		case <-stop:
+			break loop
+		default:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case <-ch:
+		t.Error("drain channel closed while requests kept resetting the quiet period")
+	default:
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("drain channel did not close after requests stopped arriving")
+	}
+}
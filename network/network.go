@@ -14,13 +14,19 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+// Package network contains k8s networking plumbing for Knative. Its
+// header and probe helpers have moved to pkg/http/header and
+// pkg/http/probe respectively; the deprecated symbols below forward to
+// them so that existing callers keep compiling while they migrate to
+// the new import paths.
 package network
 
 import (
-	"fmt"
 	"net/http"
-	"strings"
 	"time"
+
+	"knative.dev/pkg/http/header"
+	"knative.dev/pkg/http/probe"
 )
 
 const (
@@ -45,53 +51,43 @@ const (
 	// the webhook would get a bad request from the API Server when running
 	// under chaos.
 	DefaultDrainTimeout = 45 * time.Second
+)
 
-	// UserAgentKey is the constant for header "User-Agent".
-	UserAgentKey = "User-Agent"
+// Deprecated: use header.UserAgentKey.
+const UserAgentKey = header.UserAgentKey
 
-	// ProbeHeaderName is the name of a header that can be added to
-	// requests to probe the knative networking layer.  Requests
-	// with this header will not be passed to the user container or
-	// included in request metrics.
-	ProbeHeaderName = "K-Network-Probe"
+// Deprecated: use header.ProbeHeaderName.
+const ProbeHeaderName = header.ProbeHeaderName
 
-	// ProbeHeaderValue is the value of a header that can be added to
-	// requests to probe the knative networking layer.  Requests
-	// with `K-Network-Probe` this value will not be passed to the user
-	// container or included in request metrics.
-	ProbeHeaderValue = "probe"
+// Deprecated: use header.ProbeHeaderValue.
+const ProbeHeaderValue = header.ProbeHeaderValue
 
-	// HashHeaderName is the name of an internal header that Ingress controller
-	// uses to find out which version of the networking config is deployed.
-	HashHeaderName = "K-Network-Hash"
+// Deprecated: use header.HashHeaderName.
+const HashHeaderName = header.HashHeaderName
 
-	// Since K8s 1.8, prober requests have
-	//   User-Agent = "kube-probe/{major-version}.{minor-version}".
-	KubeProbeUAPrefix = "kube-probe/"
+// Deprecated: use header.KubeProbeUAPrefix.
+const KubeProbeUAPrefix = header.KubeProbeUAPrefix
 
-	// Istio with mTLS rewrites probes, but their probes pass a different
-	// user-agent.  So we augment the probes with this header.
-	KubeletProbeHeaderName = "K-Kubelet-Probe"
-)
+// Deprecated: use header.KubeletProbeHeaderName.
+const KubeletProbeHeaderName = header.KubeletProbeHeaderName
 
 // IsKubeletProbe returns true if the request is a Kubernetes probe.
+//
+// Deprecated: use probe.IsKubeletProbe.
 func IsKubeletProbe(r *http.Request) bool {
-	return strings.HasPrefix(r.Header.Get("User-Agent"), KubeProbeUAPrefix) ||
-		r.Header.Get(KubeletProbeHeaderName) != ""
+	return probe.IsKubeletProbe(r)
 }
 
 // IsKProbe returns true if the request is a knatvie probe.
+//
+// Deprecated: use probe.IsKProbe.
 func IsKProbe(r *http.Request) bool {
-	return r.Header.Get(ProbeHeaderName) == ProbeHeaderValue
+	return probe.IsKProbe(r)
 }
 
 // ServeKProbe serve KProbe requests.
+//
+// Deprecated: use probe.ServeKProbe.
 func ServeKProbe(w http.ResponseWriter, r *http.Request) {
-	hh := r.Header.Get(HashHeaderName)
-	if hh == "" {
-		http.Error(w, fmt.Sprintf("a probe request must contain a non-empty %q header", HashHeaderName), http.StatusBadRequest)
-		return
-	}
-	w.Header().Set(HashHeaderName, hh)
-	w.WriteHeader(http.StatusOK)
+	probe.ServeKProbe(w, r)
 }
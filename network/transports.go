@@ -0,0 +1,214 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"knative.dev/pkg/http/probe"
+)
+
+// maxRetries bounds how many times the transport returned by
+// NewAutoTransport will retry a request that failed because a reused
+// connection was reset or closed by the peer.
+const maxRetries = 3
+
+// dialerFunc matches the signature of (*net.Dialer).DialContext, and is
+// the seam tests use to inject a fake dialer into the transports built
+// by this file.
+type dialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDialContext builds the dialer used by NewAutoTransport. Overridden
+// in tests.
+var newDialContext = func(connTimeout time.Duration) dialerFunc {
+	return (&net.Dialer{Timeout: connTimeout}).DialContext
+}
+
+// NewAutoTransport returns an http.RoundTripper that dials with
+// connTimeout (see DefaultConnTimeout) and applies requestTimeout as
+// its response header timeout over HTTP/1.1. It picks the protocol per
+// destination address: the first round trip to an address is tried over
+// h2c (HTTP/2 over cleartext) and, if that fails, over HTTP/1.1, and the
+// protocol that worked is used from then on. It also retries
+// idempotent requests -- GET/HEAD/OPTIONS and KProbes -- that fail with
+// a connection reset or EOF on a connection pulled from the pool, which
+// is the failure mode connTimeout's short dial timeout cannot prevent
+// since it only bounds dialing, not reuse of a connection the peer has
+// since torn down.
+func NewAutoTransport(connTimeout, requestTimeout time.Duration) http.RoundTripper {
+	dial := newDialContext(connTimeout)
+
+	h1 := &http.Transport{
+		DisableCompression:    true,
+		DialContext:           dial,
+		ResponseHeaderTimeout: requestTimeout,
+	}
+	h2 := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dial(context.Background(), network, addr)
+		},
+	}
+
+	return &retryingTransport{
+		next: &autoTransport{
+			h1:       h1,
+			h2:       h2,
+			protocol: make(map[string]http.RoundTripper),
+		},
+	}
+}
+
+// NewProberTransport returns the transport used by Knative's own
+// health/readiness probes: NewAutoTransport with DefaultConnTimeout and
+// no response header timeout, since a prober wants to fail fast on
+// connect but is willing to wait out a slow handler.
+func NewProberTransport() http.RoundTripper {
+	return NewAutoTransport(DefaultConnTimeout, 0)
+}
+
+// autoTransport picks between h2c and HTTP/1.1 per destination address.
+// The first round trip to a given address acts as the protocol probe:
+// it's attempted over h2c, and if that attempt fails (the backend
+// rejecting the h2c preface, say) the request is retried over HTTP/1.1 and that address is
+// remembered as HTTP/1.1-only from then on. That retry-on-h1 only
+// happens for the same safe methods and KProbes retryingTransport
+// retries on connection reset; for any other method a failed h2
+// attempt is surfaced to the caller as-is; autoTransport never silently
+// replays a non-idempotent request on a different transport.
+type autoTransport struct {
+	h1, h2 http.RoundTripper
+
+	mu       sync.RWMutex
+	protocol map[string]http.RoundTripper
+}
+
+func (t *autoTransport) transportFor(addr string) http.RoundTripper {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if tr, ok := t.protocol[addr]; ok {
+		return tr
+	}
+	return t.h2
+}
+
+func (t *autoTransport) remember(addr string, tr http.RoundTripper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocol[addr] = tr
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *autoTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	addr := r.URL.Host
+	tr := t.transportFor(addr)
+	t.mu.RLock()
+	_, known := t.protocol[addr]
+	t.mu.RUnlock()
+
+	// Falling back to t.h1 replays r, so it's restricted to requests
+	// that retryingTransport would itself retry -- any h2 failure on a
+	// non-idempotent request (a POST timing out after the server
+	// already processed it, say) must surface to the caller rather
+	// than risk double-executing it on h1. It's also restricted to the
+	// protocol probe, i.e. an address whose protocol isn't known yet.
+	safeToFallback := !known && (retriableMethods[r.Method] || probe.IsKProbe(r))
+
+	// The optimistic h2c probe attempt below retries on t.h1 when it
+	// fails, reusing r. That's only safe for a request with a body if
+	// the body can be rewound for the retry; if it can't, skip the
+	// probe entirely, send the request over HTTP/1.1 and remember the
+	// address as HTTP/1.1-only rather than risk sending a partially- or
+	// fully-consumed body.
+	if tr == t.h2 && safeToFallback && r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		t.remember(addr, t.h1)
+		return t.h1.RoundTrip(r)
+	}
+
+	resp, err := tr.RoundTrip(r)
+	if err != nil && tr == t.h2 && safeToFallback {
+		if r.GetBody != nil {
+			body, bodyErr := r.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			r.Body = body
+		}
+		t.remember(addr, t.h1)
+		return t.h1.RoundTrip(r)
+	}
+	if err == nil {
+		t.remember(addr, tr)
+	}
+	return resp, err
+}
+
+// retriableMethods are the HTTP methods retryingTransport will retry in
+// addition to Knative probe requests.
+var retriableMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// retryingTransport wraps a RoundTripper, retrying safe requests up to
+// maxRetries times when they fail with a connection reset or EOF.
+type retryingTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !retriableMethods[r.Method] && !probe.IsKProbe(r) {
+		return t.next.RoundTrip(r)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		resp, err = t.next.RoundTrip(r)
+		if err == nil || !isConnResetOrEOF(err) {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// isConnResetOrEOF reports whether err is the kind of transient,
+// connection-level failure worth retrying: the peer resetting the
+// connection, or closing it outright.
+func isConnResetOrEOF(err error) bool {
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	var sysErr *os.SyscallError
+	if errors.As(err, &sysErr) {
+		return errors.Is(sysErr.Err, syscall.ECONNRESET)
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeRoundTripper records the bodies of the requests it saw and
+// either errors or returns a canned response.
+type fakeRoundTripper struct {
+	err        error
+	seenBodies []string
+}
+
+func (f *fakeRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		b, _ := ioutil.ReadAll(r.Body)
+		f.seenBodies = append(f.seenBodies, string(b))
+	} else {
+		f.seenBodies = append(f.seenBodies, "")
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return httptest.NewRecorder().Result(), nil
+}
+
+func TestNewAutoTransportUsesInjectedDialer(t *testing.T) {
+	var gotTimeout time.Duration
+	var called bool
+
+	old := newDialContext
+	newDialContext = func(connTimeout time.Duration) dialerFunc {
+		gotTimeout = connTimeout
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			called = true
+			return nil, errors.New("fake dialer: no connections")
+		}
+	}
+	defer func() { newDialContext = old }()
+
+	NewAutoTransport(42*time.Millisecond, time.Second)
+
+	if gotTimeout != 42*time.Millisecond {
+		t.Errorf("connTimeout = %v, want %v", gotTimeout, 42*time.Millisecond)
+	}
+	if called {
+		t.Error("fake dialer invoked during construction; it should only run on dial")
+	}
+}
+
+func TestAutoTransportFallsBackToH1OnH2Failure(t *testing.T) {
+	h1 := &fakeRoundTripper{}
+	h2 := &fakeRoundTripper{err: errors.New("h2c preface rejected")}
+	tr := &autoTransport{h1: h1, h2: h2, protocol: make(map[string]http.RoundTripper)}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() = %v, want success from h1 fallback", err)
+	}
+
+	if got := tr.transportFor("example.com"); got != h1 {
+		t.Error("address was not remembered as HTTP/1.1-only after h2 failure")
+	}
+}
+
+func TestAutoTransportRestoresBodyOnFallback(t *testing.T) {
+	h1 := &fakeRoundTripper{}
+	h2 := &fakeRoundTripper{err: errors.New("h2c preface rejected")}
+	tr := &autoTransport{h1: h1, h2: h2, protocol: make(map[string]http.RoundTripper)}
+
+	// GET is a retriable, safe method, so it's eligible for the
+	// h2-to-h1 fallback even though it's unusual for it to carry a body.
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.GetBody == nil {
+		t.Fatal("http.NewRequest with a strings.Reader body should set GetBody")
+	}
+
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() = %v", err)
+	}
+
+	if got, want := h1.seenBodies, []string{"payload"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("h1 saw bodies %q, want %q", got, want)
+	}
+}
+
+func TestAutoTransportDoesNotFallBackForUnsafeMethod(t *testing.T) {
+	h1 := &fakeRoundTripper{}
+	h2 := &fakeRoundTripper{err: errors.New("context deadline exceeded")}
+	tr := &autoTransport{h1: h1, h2: h2, protocol: make(map[string]http.RoundTripper)}
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tr.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() succeeded, want the h2 error surfaced for a non-idempotent request")
+	}
+	if len(h1.seenBodies) != 0 {
+		t.Error("POST was silently replayed on h1 after an h2 failure; it must only ever execute once")
+	}
+	if got := tr.transportFor("example.com"); got == h1 {
+		t.Error("address was remembered as HTTP/1.1-only from an unsafe-method failure, which isn't a protocol probe")
+	}
+}
+
+func TestAutoTransportSkipsH2ProbeForUnrewindableBody(t *testing.T) {
+	h1 := &fakeRoundTripper{}
+	h2 := &fakeRoundTripper{}
+	tr := &autoTransport{h1: h1, h2: h2, protocol: make(map[string]http.RoundTripper)}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", strings.NewReader("payload"))
+	req.GetBody = nil // simulate a body http.NewRequest couldn't snapshot
+
+	if _, err := tr.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() = %v", err)
+	}
+
+	if len(h2.seenBodies) != 0 {
+		t.Error("h2 should not have been attempted for an unrewindable body")
+	}
+	if len(h1.seenBodies) != 1 {
+		t.Fatalf("h1 saw %d requests, want 1", len(h1.seenBodies))
+	}
+}
+
+func TestRetryingTransportRetriesConnReset(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if n <= 2 {
+			return nil, &net.OpError{Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+		}
+		return httptest.NewRecorder().Result(), nil
+	})
+	tr := &retryingTransport{next: next}
+
+	resp, err := tr.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("RoundTrip() = %v, want success after retries", err)
+	}
+	if resp == nil {
+		t.Fatal("RoundTrip() returned a nil response")
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestRetryingTransportSkipsNonRetriableMethods(t *testing.T) {
+	attempts := 0
+	next := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, &net.OpError{Err: io.EOF}
+	})
+	tr := &retryingTransport{next: next}
+
+	if _, err := tr.RoundTrip(httptest.NewRequest(http.MethodPost, "/", nil)); err == nil {
+		t.Fatal("RoundTrip() succeeded, want the lone EOF error to surface")
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1 (POST is not retried)", attempts)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }